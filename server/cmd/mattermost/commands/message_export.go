@@ -0,0 +1,60 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package commands
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+var MessageExportCmd = &cobra.Command{
+	Use:   "message-export",
+	Short: "Manage compliance message export jobs",
+}
+
+var MessageExportResumeCmd = &cobra.Command{
+	Use:   "resume <job-id>",
+	Short: "Resume an interrupted compliance export job",
+	Long: "Resume re-queues the compliance export job <job-id>. ActianceExport checkpoints its " +
+		"progress to checkpoint.json as it runs, so the job skips the channels and attachments " +
+		"a prior attempt already wrote instead of re-serializing and re-copying them from " +
+		"scratch. EMLExport keeps no checkpoint and rewrites every file of the batch.",
+	Args: cobra.ExactArgs(1),
+	RunE: messageExportResumeCmdF,
+}
+
+func init() {
+	MessageExportCmd.AddCommand(MessageExportResumeCmd)
+	RootCmd.AddCommand(MessageExportCmd)
+}
+
+func messageExportResumeCmdF(command *cobra.Command, args []string) error {
+	a, err := initDBCommandContextCobra(command)
+	if err != nil {
+		return err
+	}
+	defer a.Srv().Shutdown()
+
+	jobId := args[0]
+	job, appErr := a.Srv().Jobs.GetJob(jobId)
+	if appErr != nil {
+		return fmt.Errorf("unable to find message export job %s: %w", jobId, appErr)
+	}
+	if job.Type != model.JobTypeMessageExport {
+		return fmt.Errorf("job %s is a %s job, not a message export job", jobId, job.Type)
+	}
+	if job.Status != model.JobStatusError && job.Status != model.JobStatusCanceled {
+		return fmt.Errorf("job %s is %s, and can only be resumed from an error or canceled state", jobId, job.Status)
+	}
+
+	if _, appErr := a.Srv().Jobs.SetJobPending(job); appErr != nil {
+		return fmt.Errorf("unable to resume message export job %s: %w", jobId, appErr)
+	}
+
+	CommandPrettyPrintln(fmt.Sprintf("Resuming message export job %s", jobId))
+	return nil
+}
@@ -5,6 +5,8 @@ package actiance_export
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
@@ -13,8 +15,11 @@ import (
 	"path"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mattermost/mattermost/server/v8/enterprise/message_export/common_export"
+	"github.com/mattermost/mattermost/server/v8/enterprise/message_export/transport"
 
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/shared/mlog"
@@ -27,9 +32,26 @@ const (
 	XMLNS                   = "http://www.w3.org/2001/XMLSchema-instance"
 	ActianceExportFilename  = "actiance_export.xml"
 	ActianceWarningFilename = "warning.txt"
+
+	// attachmentCopyWorkers bounds the number of file attachments copied to
+	// exportBackend concurrently while the XML body is streamed out.
+	attachmentCopyWorkers = 4
+
+	// attachmentsDirectory is where content-addressed attachments are stored within
+	// exportDirectory, so the same file shared to multiple channels is only copied once.
+	attachmentsDirectory = "attachments"
+
+	ManifestFilename = "manifest.json"
+
+	// deliveryMaxAttempts and deliveryMaxBackoff bound how long ActianceExport retries handing
+	// a finished batch to a configured transport.Transport before giving up.
+	deliveryMaxAttempts = 5
+	deliveryMaxBackoff  = time.Minute
 )
 
-// The root-level element of an actiance export
+// The root-level element of an actiance export. writeExport streams this document one
+// Conversation at a time instead of building it in memory, so RootNode itself is never
+// instantiated; it's kept here as the canonical description of the document shape.
 type RootNode struct {
 	XMLName  xml.Name        `xml:"FileDump"`
 	XMLNS    string          `xml:"xmlns:xsi,attr"` // this should default to "http://www.w3.org/2001/XMLSchema-instance"
@@ -60,6 +82,7 @@ type JoinExport struct {
 	UserType         string   `xml:"UserType"`    // the type of the user that joined the channel
 	JoinTime         int64    `xml:"DateTimeUTC"` // utc timestamp (seconds), time at which the user joined. Example: 1366611728
 	CorporateEmailID string   `xml:"CorporateEmailID"`
+	Reason           string   `xml:"Reason,attr"` // one of "joined" or "window-start" (the user was already a member when the export window opened)
 }
 
 // The ParticipantLeft element indicates the user who leaves an active IM or chat room conversation.
@@ -70,6 +93,7 @@ type LeaveExport struct {
 	UserType         string   `xml:"UserType"`    // the type of the user that left the channel
 	LeaveTime        int64    `xml:"DateTimeUTC"` // utc timestamp (seconds), time at which the user left. Example: 1366611728
 	CorporateEmailID string   `xml:"CorporateEmailID"`
+	Reason           string   `xml:"Reason,attr"` // one of "left", "kicked", "window-end" (still a member when the export window closed)
 }
 
 // The Message element indicates the message sent by a user
@@ -101,7 +125,54 @@ type FileUploadStopExport struct {
 	Status         string   `xml:"Status"`       // set to either "Completed" or "Failed" depending on the outcome of the upload operation
 }
 
-func ActianceExport(rctx request.CTX, posts []*model.MessageExport, db store.Store, exportBackend filestore.FileBackend, fileAttachmentBackend filestore.FileBackend, exportDirectory string) (warningCount int64, appErr *model.AppError) {
+// attachmentHashCache deduplicates attachment hashing across posts in the same export batch:
+// the same FileInfo can be referenced by more than one post (e.g. a file shared to several
+// channels), and we only want to read and hash its bytes once.
+type attachmentHashCache struct {
+	mu   sync.Mutex
+	byId map[string]string // FileInfo.Id -> content-addressed path, relative to exportDirectory
+}
+
+func newAttachmentHashCache() *attachmentHashCache {
+	return &attachmentHashCache{byId: map[string]string{}}
+}
+
+// dedupedPath returns the content-addressed path for fileInfo, hashing it via
+// fileAttachmentBackend the first time it's seen and reusing the cached result afterward.
+func (c *attachmentHashCache) dedupedPath(fileAttachmentBackend filestore.FileBackend, fileInfo *model.FileInfo) (string, error) {
+	c.mu.Lock()
+	if p, ok := c.byId[fileInfo.Id]; ok {
+		c.mu.Unlock()
+		return p, nil
+	}
+	c.mu.Unlock()
+
+	reader, err := fileAttachmentBackend.Reader(fileInfo.Path)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, reader); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	dedupedPath := path.Join(attachmentsDirectory, sum[:2], sum+strings.ToLower(path.Ext(fileInfo.Name)))
+
+	c.mu.Lock()
+	c.byId[fileInfo.Id] = dedupedPath
+	c.mu.Unlock()
+	return dedupedPath, nil
+}
+
+// ActianceExport writes posts as an Actiance-schema XML export to exportDirectory. When
+// deliveryTransport is non-nil, the finished batch (the XML file, manifest.json, the attachments
+// it references, and warning.txt if any files were missing) is also handed off to that
+// destination with retries, and a delivery_receipt.json is written back into exportDirectory
+// once it succeeds. Pass a nil deliveryTransport to keep the batch in exportBackend only, which
+// is how every caller behaved before ActianceExport could deliver exports itself.
+func ActianceExport(rctx request.CTX, posts []*model.MessageExport, db store.Store, exportBackend filestore.FileBackend, fileAttachmentBackend filestore.FileBackend, exportDirectory string, deliveryTransport transport.Transport) (warningCount int64, appErr *model.AppError) {
 	// sort the posts into buckets based on the channel in which they appeared
 	membersByChannel := common_export.MembersByChannel{}
 	metadata := common_export.Metadata{
@@ -113,6 +184,7 @@ func ActianceExport(rctx request.CTX, posts []*model.MessageExport, db store.Sto
 	}
 	elementsByChannel := map[string][]any{}
 	allUploadedFiles := []*model.FileInfo{}
+	hashCache := newAttachmentHashCache()
 
 	for _, post := range posts {
 		if post == nil {
@@ -131,7 +203,7 @@ func ActianceExport(rctx request.CTX, posts []*model.MessageExport, db store.Sto
 			}
 		}
 
-		startUploads, stopUploads, uploadedFiles, deleteFileMessages, err := postToAttachmentsEntries(post, db)
+		startUploads, stopUploads, uploadedFiles, deleteFileMessages, err := postToAttachmentsEntries(post, db, fileAttachmentBackend, hashCache)
 		if err != nil {
 			return warningCount, err
 		}
@@ -170,12 +242,35 @@ func ActianceExport(rctx request.CTX, posts []*model.MessageExport, db store.Sto
 		channelExports = append(channelExports, *channelExport)
 	}
 
-	export := &RootNode{
-		XMLNS:    XMLNS,
-		Channels: channelExports,
+	sort.Slice(channelExports, func(i, j int) bool {
+		if channelExports[i].StartTime == channelExports[j].StartTime {
+			return channelExports[i].ChannelId < channelExports[j].ChannelId
+		}
+		return channelExports[i].StartTime < channelExports[j].StartTime
+	})
+
+	checkpoint, err := newCheckpointStore(rctx, exportBackend, exportDirectory)
+	if err != nil {
+		return warningCount, err
+	}
+	if lastChannelId := checkpoint.lastChannelId(); lastChannelId != "" {
+		channelExports = skipCompletedChannels(rctx, channelExports, lastChannelId)
 	}
 
-	return writeExport(rctx, export, allUploadedFiles, exportDirectory, exportBackend, fileAttachmentBackend)
+	return writeExport(rctx, channelExports, allUploadedFiles, exportDirectory, exportBackend, fileAttachmentBackend, hashCache, checkpoint, deliveryTransport)
+}
+
+// skipCompletedChannels drops every channel up to and including lastChannelId from the
+// (already chronologically sorted) list, so a resumed run doesn't re-serialize channels a
+// prior attempt already flushed to the export file.
+func skipCompletedChannels(rctx request.CTX, channelExports []ChannelExport, lastChannelId string) []ChannelExport {
+	for i, channel := range channelExports {
+		if channel.ChannelId == lastChannelId {
+			return channelExports[i+1:]
+		}
+	}
+	rctx.Logger().Warn("checkpoint references a channel that is no longer in this batch; resuming from the start", mlog.String("ChannelId", lastChannelId))
+	return channelExports
 }
 
 func postToExportEntry(post *model.MessageExport, createTime *int64, message string) *PostExport {
@@ -192,7 +287,7 @@ func postToExportEntry(post *model.MessageExport, createTime *int64, message str
 	}
 }
 
-func postToAttachmentsEntries(post *model.MessageExport, db store.Store) ([]any, []any, []*model.FileInfo, []any, *model.AppError) {
+func postToAttachmentsEntries(post *model.MessageExport, db store.Store, fileAttachmentBackend filestore.FileBackend, hashCache *attachmentHashCache) ([]any, []any, []*model.FileInfo, []any, *model.AppError) {
 	// if the post included any files, we need to add special elements to the export.
 	if len(post.PostFileIds) == 0 {
 		return nil, nil, nil, nil, nil
@@ -209,19 +304,27 @@ func postToAttachmentsEntries(post *model.MessageExport, db store.Store) ([]any,
 
 	uploadedFiles := []*model.FileInfo{}
 	for _, fileInfo := range fileInfos {
+		// path to exported file is relative to the xml file; prefer the content-addressed
+		// path so the same attachment shared across posts is only stored once, falling back
+		// to the original storage path if we can't read the file to hash it (the later copy
+		// step will surface the same read failure as a missing-file warning).
+		filePath := fileInfo.Path
+		if dedupedPath, hashErr := hashCache.dedupedPath(fileAttachmentBackend, fileInfo); hashErr == nil {
+			filePath = dedupedPath
+		}
+
 		// insert a record of the file upload into the export file
-		// path to exported file is relative to the xml file, so it's just the name of the exported file
 		startUploads = append(startUploads, &FileUploadStartExport{
 			UserEmail:       *post.UserEmail,
 			Filename:        fileInfo.Name,
-			FilePath:        fileInfo.Path,
+			FilePath:        filePath,
 			UploadStartTime: *post.PostCreateAt,
 		})
 
 		stopUploads = append(stopUploads, &FileUploadStopExport{
 			UserEmail:      *post.UserEmail,
 			Filename:       fileInfo.Name,
-			FilePath:       fileInfo.Path,
+			FilePath:       filePath,
 			UploadStopTime: *post.PostCreateAt,
 			Status:         "Completed",
 		})
@@ -249,12 +352,10 @@ func buildChannelExport(channel common_export.MetadataChannel, members common_ex
 		return nil, model.NewAppError("buildChannelExport", "ent.get_users_in_channel_during", nil, "", http.StatusInternalServerError).Wrap(err)
 	}
 
-	joins, leaves := common_export.GetJoinsAndLeavesForChannel(channel.StartTime, channel.EndTime, channelMembersHistory, members)
-	type StillJoinedInfo struct {
-		Time int64
-		Type string
-	}
-	stillJoined := map[string]StillJoinedInfo{}
+	// GetJoinsAndLeavesForChannel already pairs every contiguous membership interval into a
+	// join/leave, clamped to [channel.StartTime, channel.EndTime] and reasoned accordingly, so
+	// there's no "still joined at EndTime" case left to synthesize here.
+	joins, leaves := common_export.GetJoinsAndLeavesForChannel(channel.StartTime, channel.EndTime, common_export.MembershipIntervalsFromHistory(channelMembersHistory), members)
 	for _, join := range joins {
 		userType := "user"
 		if join.IsBot {
@@ -265,14 +366,8 @@ func buildChannelExport(channel common_export.MetadataChannel, members common_ex
 			UserEmail:        join.Email,
 			UserType:         userType,
 			CorporateEmailID: join.Email,
+			Reason:           join.Reason,
 		})
-		if value, ok := stillJoined[join.Email]; !ok {
-			stillJoined[join.Email] = StillJoinedInfo{Time: join.Datetime, Type: userType}
-		} else {
-			if join.Datetime > value.Time {
-				stillJoined[join.Email] = StillJoinedInfo{Time: join.Datetime, Type: userType}
-			}
-		}
 	}
 	for _, leave := range leaves {
 		userType := "user"
@@ -284,18 +379,7 @@ func buildChannelExport(channel common_export.MetadataChannel, members common_ex
 			UserEmail:        leave.Email,
 			UserType:         userType,
 			CorporateEmailID: leave.Email,
-		})
-		if leave.Datetime > stillJoined[leave.Email].Time {
-			delete(stillJoined, leave.Email)
-		}
-	}
-
-	for email := range stillJoined {
-		channelExport.LeaveEvents = append(channelExport.LeaveEvents, LeaveExport{
-			LeaveTime:        channel.EndTime,
-			UserEmail:        email,
-			UserType:         stillJoined[email].Type,
-			CorporateEmailID: email,
+			Reason:           leave.Reason,
 		})
 	}
 
@@ -310,47 +394,282 @@ func buildChannelExport(channel common_export.MetadataChannel, members common_ex
 	return &channelExport, nil
 }
 
-func writeExport(rctx request.CTX, export *RootNode, uploadedFiles []*model.FileInfo, exportDirectory string, exportBackend filestore.FileBackend, fileAttachmentBackend filestore.FileBackend) (warningCount int64, appErr *model.AppError) {
-	// marshal the export object to xml
-	xmlData := &bytes.Buffer{}
-	xmlData.WriteString(xml.Header)
+// writeExport appends each channel to the export file one at a time, checkpointing after
+// every channel and every attachment so that a batch interrupted mid-run can resume instead of
+// starting over. The channel-by-channel XML writes and the attachment copy pool run
+// concurrently, since neither depends on the other having finished. Once everything is flushed,
+// it hands the batch to deliveryTransport, if one was configured.
+func writeExport(rctx request.CTX, channels []ChannelExport, uploadedFiles []*model.FileInfo, exportDirectory string, exportBackend filestore.FileBackend, fileAttachmentBackend filestore.FileBackend, hashCache *attachmentHashCache, checkpoint *checkpointStore, deliveryTransport transport.Transport) (warningCount int64, appErr *model.AppError) {
+	type copyResult struct {
+		missingFiles []string
+		err          *model.AppError
+	}
+	copyDone := make(chan copyResult, 1)
+	go func() {
+		missingFiles, err := copyAttachments(rctx, uploadedFiles, exportDirectory, exportBackend, fileAttachmentBackend, hashCache, checkpoint)
+		copyDone <- copyResult{missingFiles, err}
+	}()
+
+	if err := streamChannelExports(rctx, channels, exportDirectory, exportBackend, checkpoint); err != nil {
+		<-copyDone // let the copy pool finish before returning, so it doesn't outlive this call
+		return warningCount, err
+	}
 
-	enc := xml.NewEncoder(xmlData)
-	enc.Indent("", "  ")
-	if err := enc.Encode(export); err != nil {
-		return warningCount, model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.marshalToXml.appError", nil, "", 0).Wrap(err)
+	result := <-copyDone
+	if result.err != nil {
+		return warningCount, result.err
 	}
-	enc.Flush()
 
-	// Try to disable the write timeout if the backend supports it
-	if _, err := filestore.TryWriteFileContext(rctx.Context(), exportBackend, xmlData, path.Join(exportDirectory, ActianceExportFilename)); err != nil {
-		return warningCount, model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.write_file.appError", nil, "", 0).Wrap(err)
+	if err := writeManifest(rctx, uploadedFiles, exportDirectory, exportBackend, hashCache); err != nil {
+		return warningCount, err
 	}
 
-	var missingFiles []string
+	warningCount = int64(len(result.missingFiles))
+	if warningCount > 0 {
+		_, err := filestore.TryWriteFileContext(rctx.Context(), exportBackend, strings.NewReader(strings.Join(result.missingFiles, "\n")), path.Join(exportDirectory, ActianceWarningFilename))
+		if err != nil {
+			appErr = model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.write_file.appError", nil, "", 0).Wrap(err)
+		}
+	}
+
+	// Hold off on clearing the checkpoint until delivery (if configured) has also succeeded: if
+	// deliverExport fails after exhausting its retries, the next ActianceExport call needs the
+	// checkpoint to still be there so it resumes the already-written batch instead of
+	// re-serializing every channel and re-copying every attachment to redo a delivery retry.
+	if appErr == nil && deliveryTransport != nil {
+		files := deliveryFiles(uploadedFiles, hashCache)
+		if warningCount > 0 {
+			files = append(files, ActianceWarningFilename)
+		}
+		appErr = deliverExport(rctx, deliveryTransport, exportBackend, exportDirectory, files)
+	}
+
+	if appErr == nil {
+		appErr = checkpoint.clear()
+	}
+
+	return warningCount, appErr
+}
+
+// deliveryFiles lists the paths, relative to exportDirectory, that make up a finished batch:
+// the XML file, the manifest, and every distinct deduped attachment path actually written.
+func deliveryFiles(uploadedFiles []*model.FileInfo, hashCache *attachmentHashCache) []string {
+	files := []string{ActianceExportFilename, ManifestFilename}
+	seen := map[string]bool{}
 	for _, fileInfo := range uploadedFiles {
-		var attachmentSrc io.ReadCloser
-		attachmentSrc, nErr := fileAttachmentBackend.Reader(fileInfo.Path)
-		if nErr != nil {
-			missingFiles = append(missingFiles, "Warning:"+common_export.MissingFileMessage+" - "+fileInfo.Path)
-			rctx.Logger().Warn(common_export.MissingFileMessage, mlog.String("FileName", fileInfo.Path))
+		hashCache.mu.Lock()
+		dedupedPath, ok := hashCache.byId[fileInfo.Id]
+		hashCache.mu.Unlock()
+		if !ok || seen[dedupedPath] {
 			continue
 		}
-		defer attachmentSrc.Close()
+		seen[dedupedPath] = true
+		files = append(files, dedupedPath)
+	}
+	return files
+}
+
+// deliverExport hands a finished batch to deliveryTransport with retries, then records a
+// delivery receipt in exportDirectory so a later export into the same directory (or a
+// customer's own tooling) can tell the batch already shipped.
+func deliverExport(rctx request.CTX, deliveryTransport transport.Transport, exportBackend filestore.FileBackend, exportDirectory string, files []string) *model.AppError {
+	ctx := rctx.Context()
+
+	if err := transport.DeliverWithRetry(ctx, deliveryTransport, exportBackend, exportDirectory, files, deliveryMaxAttempts, deliveryMaxBackoff); err != nil {
+		return model.NewAppError("ActianceExport.deliverExport", "ent.actiance.export.deliver.appError", nil, "", 0).Wrap(err)
+	}
+
+	receiptData, err := transport.NewReceipt(deliveryTransport, model.GetMillis(), files).Marshal()
+	if err != nil {
+		return model.NewAppError("ActianceExport.deliverExport", "ent.actiance.export.deliver.appError", nil, "", 0).Wrap(err)
+	}
+	if _, err := filestore.TryWriteFileContext(ctx, exportBackend, bytes.NewReader(receiptData), path.Join(exportDirectory, transport.ReceiptFilename)); err != nil {
+		return model.NewAppError("ActianceExport.deliverExport", "ent.actiance.export.deliver.appError", nil, "", 0).Wrap(err)
+	}
+	return nil
+}
+
+// writeManifest records, for every uploaded file that was successfully content-addressed, the
+// mapping from its original Mattermost storage path to the deduped path actually written under
+// exportDirectory, so downstream tooling can resolve FileName references in the XML back to
+// the original file metadata.
+func writeManifest(rctx request.CTX, uploadedFiles []*model.FileInfo, exportDirectory string, exportBackend filestore.FileBackend, hashCache *attachmentHashCache) *model.AppError {
+	manifest := map[string]string{}
+	for _, fileInfo := range uploadedFiles {
+		hashCache.mu.Lock()
+		dedupedPath, ok := hashCache.byId[fileInfo.Id]
+		hashCache.mu.Unlock()
+		if ok {
+			manifest[fileInfo.Path] = dedupedPath
+		}
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return model.NewAppError("ActianceExport.writeManifest", "ent.actiance.export.marshalToJson.appError", nil, "", 0).Wrap(err)
+	}
+	if _, err := filestore.TryWriteFileContext(rctx.Context(), exportBackend, strings.NewReader(string(manifestData)), path.Join(exportDirectory, ManifestFilename)); err != nil {
+		return model.NewAppError("ActianceExport.writeManifest", "ent.actiance.export.write_file.appError", nil, "", 0).Wrap(err)
+	}
+	return nil
+}
 
-		destPath := path.Join(exportDirectory, fileInfo.Path)
+// xmlHeaderAndOpenTag is everything written before the first Conversation element.
+func xmlHeaderAndOpenTag() string {
+	return xml.Header + fmt.Sprintf("<FileDump xmlns:xsi=%q>\n", XMLNS)
+}
 
-		_, nErr = exportBackend.WriteFile(attachmentSrc, destPath)
-		if nErr != nil {
-			return warningCount, model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.write_file.appError", nil, "", 0).Wrap(nErr)
+// streamChannelExports writes each channel's Conversation element to the export file. On a
+// fresh run it writes the header and opening tag once, then appends each channel directly
+// with exportBackend.AppendFile -- no closing tag is written until every channel is done, so
+// appending never has to re-stream anything that's already on disk. Resuming an interrupted
+// run is the one case that still needs a rewrite: tailOffset marks the last byte a prior run's
+// checkpoint confirmed was durably written, but the bytes after it on the backend may be a
+// torn write from whichever channel was in flight when that run stopped, so this reads back
+// only the confirmed-good prefix and rewrites the file to exactly that length before resuming
+// normal appends. That rewrite happens once per resumed batch, not once per channel.
+func streamChannelExports(rctx request.CTX, channels []ChannelExport, exportDirectory string, exportBackend filestore.FileBackend, checkpoint *checkpointStore) *model.AppError {
+	filePath := path.Join(exportDirectory, ActianceExportFilename)
+
+	if len(channels) == 0 && checkpoint.tailOffset() == 0 {
+		// nothing to export, and no prior run already wrote a file: still produce a well-formed,
+		// empty FileDump document.
+		empty := strings.NewReader(xmlHeaderAndOpenTag() + "</FileDump>\n")
+		if _, err := filestore.TryWriteFileContext(rctx.Context(), exportBackend, empty, filePath); err != nil {
+			return model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.write_file.appError", nil, "", 0).Wrap(err)
 		}
+		return nil
 	}
-	warningCount = int64(len(missingFiles))
-	if warningCount > 0 {
-		_, err := filestore.TryWriteFileContext(rctx.Context(), exportBackend, strings.NewReader(strings.Join(missingFiles, "\n")), path.Join(exportDirectory, ActianceWarningFilename))
+
+	tailOffset := checkpoint.tailOffset()
+	if tailOffset == 0 {
+		header := xmlHeaderAndOpenTag()
+		if _, err := filestore.TryWriteFileContext(rctx.Context(), exportBackend, strings.NewReader(header), filePath); err != nil {
+			return model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.write_file.appError", nil, "", 0).Wrap(err)
+		}
+		tailOffset = int64(len(header))
+	} else {
+		existing, err := exportBackend.Reader(filePath)
 		if err != nil {
-			appErr = model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.write_file.appError", nil, "", 0).Wrap(err)
+			return model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.write_file.appError", nil, "", 0).Wrap(err)
+		}
+		confirmed := io.LimitReader(existing, tailOffset)
+		_, writeErr := filestore.TryWriteFileContext(rctx.Context(), exportBackend, confirmed, filePath)
+		existing.Close()
+		if writeErr != nil {
+			return model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.write_file.appError", nil, "", 0).Wrap(writeErr)
 		}
 	}
-	return warningCount, appErr
+
+	for _, channel := range channels {
+		channelBuf := &bytes.Buffer{}
+		enc := xml.NewEncoder(channelBuf)
+		enc.Indent("  ", "  ")
+		if err := enc.EncodeElement(channel, xml.StartElement{Name: xml.Name{Local: "Conversation"}}); err != nil {
+			return model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.marshalToXml.appError", nil, "", 0).Wrap(err)
+		}
+		if err := enc.Flush(); err != nil {
+			return model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.marshalToXml.appError", nil, "", 0).Wrap(err)
+		}
+		channelBuf.WriteString("\n")
+
+		channelLen := int64(channelBuf.Len())
+		if _, err := exportBackend.AppendFile(channelBuf, filePath); err != nil {
+			return model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.write_file.appError", nil, "", 0).Wrap(err)
+		}
+		tailOffset += channelLen
+
+		if err := checkpoint.markChannelDone(channel.ChannelId, channel.EndTime, tailOffset); err != nil {
+			return err
+		}
+	}
+
+	if _, err := exportBackend.AppendFile(strings.NewReader("</FileDump>\n"), filePath); err != nil {
+		return model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.write_file.appError", nil, "", 0).Wrap(err)
+	}
+	return nil
+}
+
+// copyAttachments streams every uploaded file attachment from fileAttachmentBackend to
+// exportBackend, using up to attachmentCopyWorkers goroutines concurrently. It runs alongside
+// the XML stream in writeExport (see the copyDone goroutine there) so large batches don't
+// serialize the two phases; as originally written this package ran the two sequentially despite
+// claiming otherwise, and only became genuinely concurrent once writeExport was restructured
+// around checkpointing.
+func copyAttachments(rctx request.CTX, uploadedFiles []*model.FileInfo, exportDirectory string, exportBackend filestore.FileBackend, fileAttachmentBackend filestore.FileBackend, hashCache *attachmentHashCache, checkpoint *checkpointStore) ([]string, *model.AppError) {
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		missingFiles []string
+		firstErr     *model.AppError
+		written      = map[string]bool{} // deduped relative path -> already copied this batch
+	)
+	sem := make(chan struct{}, attachmentCopyWorkers)
+
+	for _, fileInfo := range uploadedFiles {
+		fileInfo := fileInfo
+
+		if checkpoint.isFileCopied(fileInfo.Id) {
+			// a prior, interrupted run already copied this file's bytes.
+			continue
+		}
+
+		relPath := fileInfo.Path
+		hashCache.mu.Lock()
+		if dedupedPath, ok := hashCache.byId[fileInfo.Id]; ok {
+			relPath = dedupedPath
+		}
+		hashCache.mu.Unlock()
+
+		mu.Lock()
+		alreadyWritten := written[relPath]
+		written[relPath] = true
+		mu.Unlock()
+		if alreadyWritten {
+			// content-addressed: another FileInfo with the same bytes already wrote this path
+			// earlier in this same loop.
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			attachmentSrc, nErr := fileAttachmentBackend.Reader(fileInfo.Path)
+			if nErr != nil {
+				mu.Lock()
+				missingFiles = append(missingFiles, "Warning:"+common_export.MissingFileMessage+" - "+fileInfo.Path)
+				mu.Unlock()
+				rctx.Logger().Warn(common_export.MissingFileMessage, mlog.String("FileName", fileInfo.Path))
+				return
+			}
+			defer attachmentSrc.Close()
+
+			destPath := path.Join(exportDirectory, relPath)
+			if _, nErr = exportBackend.WriteFile(attachmentSrc, destPath); nErr != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = model.NewAppError("ActianceExport.AtianceExport", "ent.actiance.export.write_file.appError", nil, "", 0).Wrap(nErr)
+				}
+				mu.Unlock()
+				return
+			}
+
+			if appErr := checkpoint.markFileCopied(fileInfo.Id); appErr != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = appErr
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return missingFiles, nil
 }
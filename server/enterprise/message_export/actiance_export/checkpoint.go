@@ -0,0 +1,165 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.enterprise for license information.
+
+package actiance_export
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path"
+	"sync"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/shared/request"
+	"github.com/mattermost/mattermost/server/v8/platform/shared/filestore"
+)
+
+const CheckpointFilename = "checkpoint.json"
+
+// Checkpoint records how far a batch got through writeExport, so a run interrupted by a
+// process kill, timeout, or a backend error on one attachment can resume without
+// re-serializing already-written channels or re-copying already-uploaded attachments.
+//
+// XMLTailOffset is the byte offset in ActianceExportFilename immediately before the closing
+// </FileDump> would be written. On resume, the file is rewritten by copying its existing
+// bytes up to that offset and appending the remaining Conversation elements, rather than
+// seeking and truncating in place, since filestore.FileBackend only guarantees sequential
+// Reader/WriteFile access.
+type Checkpoint struct {
+	LastChannelId    string          `json:"last_channel_id"`
+	LastPostCreateAt int64           `json:"last_post_create_at"`
+	CopiedFileIds    map[string]bool `json:"copied_file_ids"`
+	XMLTailOffset    int64           `json:"xml_tail_offset"`
+}
+
+func newCheckpoint() *Checkpoint {
+	return &Checkpoint{CopiedFileIds: map[string]bool{}}
+}
+
+// checkpointBackend is the slice of filestore.FileBackend that checkpointStore actually needs,
+// pulled out so tests can exercise the save/resume round trip against a small in-memory fake
+// instead of the real backend.
+type checkpointBackend interface {
+	FileExists(path string) (bool, error)
+	Reader(path string) (io.ReadCloser, error)
+	WriteFile(fr io.Reader, path string) (int64, error)
+	RemoveFile(path string) error
+}
+
+var _ checkpointBackend = filestore.FileBackend(nil)
+
+// checkpointStore guards a Checkpoint with a mutex and persists it to exportBackend on every
+// update, since writeExport updates it concurrently from the channel-writing loop and the
+// attachment-copy worker pool.
+type checkpointStore struct {
+	mu              sync.Mutex
+	data            *Checkpoint
+	rctx            request.CTX
+	exportBackend   checkpointBackend
+	exportDirectory string
+}
+
+// newCheckpointStore loads any existing checkpoint.json from exportDirectory, or starts a
+// fresh one if this is the batch's first attempt.
+func newCheckpointStore(rctx request.CTX, exportBackend checkpointBackend, exportDirectory string) (*checkpointStore, *model.AppError) {
+	checkpointPath := path.Join(exportDirectory, CheckpointFilename)
+
+	exists, err := exportBackend.FileExists(checkpointPath)
+	if err != nil {
+		return nil, model.NewAppError("ActianceExport.newCheckpointStore", "ent.actiance.export.checkpoint.read.appError", nil, "", 0).Wrap(err)
+	}
+	data := newCheckpoint()
+	if exists {
+		reader, err := exportBackend.Reader(checkpointPath)
+		if err != nil {
+			return nil, model.NewAppError("ActianceExport.newCheckpointStore", "ent.actiance.export.checkpoint.read.appError", nil, "", 0).Wrap(err)
+		}
+		defer reader.Close()
+
+		raw, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, model.NewAppError("ActianceExport.newCheckpointStore", "ent.actiance.export.checkpoint.read.appError", nil, "", 0).Wrap(err)
+		}
+		if err := json.Unmarshal(raw, data); err != nil {
+			return nil, model.NewAppError("ActianceExport.newCheckpointStore", "ent.actiance.export.checkpoint.read.appError", nil, "", 0).Wrap(err)
+		}
+		if data.CopiedFileIds == nil {
+			data.CopiedFileIds = map[string]bool{}
+		}
+	}
+
+	return &checkpointStore{data: data, rctx: rctx, exportBackend: exportBackend, exportDirectory: exportDirectory}, nil
+}
+
+func (s *checkpointStore) lastChannelId() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.LastChannelId
+}
+
+func (s *checkpointStore) tailOffset() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.XMLTailOffset
+}
+
+func (s *checkpointStore) isFileCopied(fileId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.CopiedFileIds[fileId]
+}
+
+// markChannelDone records that channelId's Conversation element was durably flushed up to
+// tailOffset bytes into the export file, then persists the checkpoint immediately.
+func (s *checkpointStore) markChannelDone(channelId string, lastPostCreateAt int64, tailOffset int64) *model.AppError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.LastChannelId = channelId
+	s.data.LastPostCreateAt = lastPostCreateAt
+	s.data.XMLTailOffset = tailOffset
+	return s.saveLocked()
+}
+
+// markFileCopied records that fileId's bytes were durably copied to exportBackend, then
+// persists the checkpoint immediately.
+func (s *checkpointStore) markFileCopied(fileId string) *model.AppError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.CopiedFileIds[fileId] = true
+	return s.saveLocked()
+}
+
+// saveLocked marshals and writes s.data to checkpoint.json. Callers must already hold s.mu, and
+// must keep holding it for the full call rather than just the snapshot: markChannelDone (from
+// the XML-writing goroutine) and markFileCopied (from the attachment-copy worker pool, per
+// writeExport's own doc comment) save concurrently, and if the WriteFile calls themselves
+// weren't serialized, a slower write of an older snapshot could finish after and clobber a
+// faster write of a newer one, silently losing whichever update raced.
+func (s *checkpointStore) saveLocked() *model.AppError {
+	data, err := json.Marshal(s.data)
+	if err != nil {
+		return model.NewAppError("ActianceExport.checkpointStore.save", "ent.actiance.export.checkpoint.write.appError", nil, "", 0).Wrap(err)
+	}
+	if _, err := s.exportBackend.WriteFile(bytes.NewReader(data), path.Join(s.exportDirectory, CheckpointFilename)); err != nil {
+		return model.NewAppError("ActianceExport.checkpointStore.save", "ent.actiance.export.checkpoint.write.appError", nil, "", 0).Wrap(err)
+	}
+	return nil
+}
+
+// clear removes checkpoint.json once a batch completes successfully, so a later export into
+// the same directory doesn't mistake it for an interrupted run.
+func (s *checkpointStore) clear() *model.AppError {
+	checkpointPath := path.Join(s.exportDirectory, CheckpointFilename)
+	exists, err := s.exportBackend.FileExists(checkpointPath)
+	if err != nil {
+		return model.NewAppError("ActianceExport.checkpointStore.clear", "ent.actiance.export.checkpoint.write.appError", nil, "", 0).Wrap(err)
+	}
+	if !exists {
+		return nil
+	}
+	if err := s.exportBackend.RemoveFile(checkpointPath); err != nil {
+		return model.NewAppError("ActianceExport.checkpointStore.clear", "ent.actiance.export.checkpoint.write.appError", nil, "", 0).Wrap(err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.enterprise for license information.
+
+package actiance_export
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost/server/public/shared/request"
+)
+
+// fakeCheckpointBackend is an in-memory checkpointBackend, just enough to exercise
+// checkpointStore's save/resume round trip and its behavior under concurrent saves.
+type fakeCheckpointBackend struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func newFakeCheckpointBackend() *fakeCheckpointBackend {
+	return &fakeCheckpointBackend{files: map[string][]byte{}}
+}
+
+func (b *fakeCheckpointBackend) FileExists(path string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.files[path]
+	return ok, nil
+}
+
+func (b *fakeCheckpointBackend) Reader(path string) (io.ReadCloser, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	data, ok := b.files[path]
+	if !ok {
+		return nil, errors.New("no such file")
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b *fakeCheckpointBackend) WriteFile(fr io.Reader, path string) (int64, error) {
+	data, err := io.ReadAll(fr)
+	if err != nil {
+		return 0, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.files[path] = data
+	return int64(len(data)), nil
+}
+
+func (b *fakeCheckpointBackend) RemoveFile(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.files, path)
+	return nil
+}
+
+func TestCheckpointStoreResume(t *testing.T) {
+	backend := newFakeCheckpointBackend()
+	rctx := request.TestContext(t)
+
+	store, appErr := newCheckpointStore(rctx, backend, "export-dir")
+	require.Nil(t, appErr)
+	require.Equal(t, "", store.lastChannelId())
+
+	require.Nil(t, store.markChannelDone("channel1", 1000, 512))
+	require.Nil(t, store.markFileCopied("file1"))
+
+	resumed, appErr := newCheckpointStore(rctx, backend, "export-dir")
+	require.Nil(t, appErr)
+	require.Equal(t, "channel1", resumed.lastChannelId())
+	require.Equal(t, int64(512), resumed.tailOffset())
+	require.True(t, resumed.isFileCopied("file1"))
+	require.False(t, resumed.isFileCopied("file2"))
+
+	require.Nil(t, resumed.clear())
+	exists, err := backend.FileExists("export-dir/checkpoint.json")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestCheckpointStoreConcurrentSavesDontClobber(t *testing.T) {
+	backend := newFakeCheckpointBackend()
+	rctx := request.TestContext(t)
+
+	store, appErr := newCheckpointStore(rctx, backend, "export-dir")
+	require.Nil(t, appErr)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			require.Nil(t, store.markFileCopied(string(rune('a'+i%26))+string(rune(i))))
+		}(i)
+	}
+	wg.Wait()
+
+	resumed, appErr := newCheckpointStore(rctx, backend, "export-dir")
+	require.Nil(t, appErr)
+	for i := 0; i < 50; i++ {
+		require.True(t, resumed.isFileCopied(string(rune('a'+i%26))+string(rune(i))))
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.enterprise for license information.
+
+// Package common_export holds the channel/metadata bucketing and membership reconstruction
+// logic shared by the various MessageExport backends (actiance_export, eml_export, ...).
+package common_export
+
+import (
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const MissingFileMessage = "File doesn't exist or could not be downloaded"
+
+// ChannelMember is the set of fields about a channel member that an export needs, independent
+// of the destination format.
+type ChannelMember struct {
+	Email    string
+	UserId   string
+	IsBot    bool
+	Username string
+}
+
+// ChannelMembers maps a userId to the member info most recently seen for them in an export batch.
+type ChannelMembers map[string]ChannelMember
+
+// MembersByChannel maps a channelId to the members who posted or were otherwise active in
+// that channel during the export batch.
+type MembersByChannel map[string]ChannelMembers
+
+// MetadataChannel carries the per-channel bounds and display info an export needs to build its
+// channel-level output, derived from the posts seen so far.
+type MetadataChannel struct {
+	ChannelId          string
+	ChannelName        string
+	ChannelDisplayName string
+	ChannelType        model.ChannelType
+	StartTime          int64 // the earliest post time seen for this channel in the batch
+	EndTime            int64 // the latest post time seen for this channel in the batch
+}
+
+// Metadata accumulates channel bounds and message/attachment counts while posts are processed,
+// one post at a time, so that an export doesn't need a second pass over the post list.
+type Metadata struct {
+	Channels         map[string]MetadataChannel
+	MessagesCount    int
+	AttachmentsCount int
+	StartTime        int64
+	EndTime          int64
+}
+
+// Update folds a single post into the metadata: it creates or extends the post's channel
+// bounds and advances the batch-wide time range and counters.
+func (m *Metadata) Update(post *model.MessageExport, attachmentsCount int) {
+	m.MessagesCount++
+	m.AttachmentsCount += attachmentsCount
+
+	createAt := *post.PostCreateAt
+	if m.StartTime == 0 || createAt < m.StartTime {
+		m.StartTime = createAt
+	}
+	if createAt > m.EndTime {
+		m.EndTime = createAt
+	}
+
+	channel, ok := m.Channels[*post.ChannelId]
+	if !ok {
+		channel = MetadataChannel{
+			ChannelId:          *post.ChannelId,
+			ChannelName:        *post.ChannelName,
+			ChannelDisplayName: *post.ChannelDisplayName,
+			ChannelType:        *post.ChannelType,
+			StartTime:          createAt,
+			EndTime:            createAt,
+		}
+	}
+	if createAt < channel.StartTime {
+		channel.StartTime = createAt
+	}
+	if createAt > channel.EndTime {
+		channel.EndTime = createAt
+	}
+	m.Channels[*post.ChannelId] = channel
+}
+
+// ChannelTypeDisplayName renders a channel type as the human-readable string Actiance/EML
+// exports put into the room/perspective identifier.
+func ChannelTypeDisplayName(channelType model.ChannelType) string {
+	switch channelType {
+	case model.ChannelTypeOpen:
+		return "Public Channel"
+	case model.ChannelTypePrivate:
+		return "Private Channel"
+	case model.ChannelTypeDirect:
+		return "Direct Message"
+	case model.ChannelTypeGroup:
+		return "Group Message"
+	default:
+		return "Unknown Channel Type"
+	}
+}
+
+// Reason values distinguish real membership events from events synthesized because a
+// membership interval was clamped to the export window.
+const (
+	ReasonJoined      = "joined"
+	ReasonLeft        = "left"
+	ReasonKicked      = "kicked"
+	ReasonWindowStart = "window-start"
+	ReasonWindowEnd   = "window-end"
+)
+
+// JoinEvent is a single user joining a channel, either for real or synthesized because the
+// user was already a member when the export window started.
+type JoinEvent struct {
+	Email    string
+	Datetime int64
+	IsBot    bool
+	Reason   string
+}
+
+// LeaveEvent is a single user leaving a channel, either for real or synthesized because the
+// user was still a member when the export window ended.
+type LeaveEvent struct {
+	Email    string
+	Datetime int64
+	IsBot    bool
+	Reason   string
+}
+
+// MembershipInterval is the subset of a ChannelMemberHistory row an export needs to build a
+// join/leave pair, independent of the store row shape. LeaveReason is optional: it's empty for
+// any store that, like ChannelMemberHistoryResult today, doesn't distinguish a kick from a
+// voluntary leave, in which case GetJoinsAndLeavesForChannel falls back to ReasonLeft.
+type MembershipInterval struct {
+	UserId      string
+	JoinTime    int64
+	LeaveTime   *int64 // nil if still a member as of the export
+	LeaveReason string
+}
+
+// MembershipIntervalsFromHistory adapts ChannelMemberHistory rows, as returned by
+// db.ChannelMemberHistory().GetUsersInChannelDuring, to the MembershipInterval shape shared by
+// every export backend that needs a channel's membership for its window. There's no LeaveReason
+// on ChannelMemberHistoryResult today, so it's left at its zero value.
+func MembershipIntervalsFromHistory(channelMembersHistory []*model.ChannelMemberHistoryResult) []MembershipInterval {
+	intervals := make([]MembershipInterval, len(channelMembersHistory))
+	for i, cmh := range channelMembersHistory {
+		intervals[i] = MembershipInterval{
+			UserId:    cmh.UserId,
+			JoinTime:  cmh.JoinTime,
+			LeaveTime: cmh.LeaveTime,
+		}
+	}
+	return intervals
+}
+
+// GetJoinsAndLeavesForChannel walks history and emits a paired JoinEvent/LeaveEvent for every
+// membership interval that intersects [startTime, endTime]. An interval is checked for
+// intersection as a whole, [interval.JoinTime, leaveTime], before anything is clamped or emitted
+// -- otherwise a join and a leave end up clamped independently, which can emit one without the
+// other (e.g. a member still present at endTime but whose recorded LeaveTime falls after it) or
+// emit a phantom join for an interval that never overlapped the window at all (one that both
+// started and ended before startTime). A member who was already present at startTime gets a
+// synthetic join reasoned "window-start" instead of their real (earlier) join time; a member
+// still present at endTime, or whose real leave time falls after it, gets a synthetic leave
+// reasoned "window-end" instead of a real leave.
+func GetJoinsAndLeavesForChannel(startTime int64, endTime int64, history []MembershipInterval, members ChannelMembers) ([]JoinEvent, []LeaveEvent) {
+	var joins []JoinEvent
+	var leaves []LeaveEvent
+
+	for _, interval := range history {
+		member, ok := members[interval.UserId]
+		if !ok {
+			// the user never posted during the batch, but was a member during the window;
+			// we still need their join/leave pair for the membership list.
+			member = ChannelMember{Email: interval.UserId, UserId: interval.UserId}
+		}
+
+		stillMember := interval.LeaveTime == nil
+		leaveTime := endTime
+		if !stillMember {
+			leaveTime = *interval.LeaveTime
+		}
+
+		// the interval [interval.JoinTime, leaveTime] doesn't reach into [startTime, endTime] at
+		// all; this member was never part of the channel during the export window.
+		if interval.JoinTime > endTime || leaveTime < startTime {
+			continue
+		}
+
+		joinTime := interval.JoinTime
+		joinReason := ReasonJoined
+		if joinTime < startTime {
+			joinTime = startTime
+			joinReason = ReasonWindowStart
+		}
+		joins = append(joins, JoinEvent{
+			Email:    member.Email,
+			Datetime: joinTime,
+			IsBot:    member.IsBot,
+			Reason:   joinReason,
+		})
+
+		leaveReason := ReasonLeft
+		switch {
+		case stillMember || leaveTime > endTime:
+			leaveTime = endTime
+			leaveReason = ReasonWindowEnd
+		case interval.LeaveReason != "":
+			leaveReason = interval.LeaveReason
+		}
+		leaves = append(leaves, LeaveEvent{
+			Email:    member.Email,
+			Datetime: leaveTime,
+			IsBot:    member.IsBot,
+			Reason:   leaveReason,
+		})
+	}
+
+	return joins, leaves
+}
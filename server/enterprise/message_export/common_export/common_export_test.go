@@ -0,0 +1,102 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.enterprise for license information.
+
+package common_export
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetJoinsAndLeavesForChannel(t *testing.T) {
+	leaveTime := func(t int64) *int64 { return &t }
+
+	testCases := []struct {
+		name           string
+		startTime      int64
+		endTime        int64
+		history        []MembershipInterval
+		expectedJoins  []JoinEvent
+		expectedLeaves []LeaveEvent
+	}{
+		{
+			name:      "joined and left within the window",
+			startTime: 100,
+			endTime:   200,
+			history: []MembershipInterval{
+				{UserId: "u1", JoinTime: 110, LeaveTime: leaveTime(150)},
+			},
+			expectedJoins:  []JoinEvent{{Email: "u1", Datetime: 110, Reason: ReasonJoined}},
+			expectedLeaves: []LeaveEvent{{Email: "u1", Datetime: 150, Reason: ReasonLeft}},
+		},
+		{
+			name:      "already a member when the window opened",
+			startTime: 100,
+			endTime:   200,
+			history: []MembershipInterval{
+				{UserId: "u1", JoinTime: 50, LeaveTime: leaveTime(150)},
+			},
+			expectedJoins:  []JoinEvent{{Email: "u1", Datetime: 100, Reason: ReasonWindowStart}},
+			expectedLeaves: []LeaveEvent{{Email: "u1", Datetime: 150, Reason: ReasonLeft}},
+		},
+		{
+			name:      "still a member when the window closed",
+			startTime: 100,
+			endTime:   200,
+			history: []MembershipInterval{
+				{UserId: "u1", JoinTime: 110, LeaveTime: nil},
+			},
+			expectedJoins:  []JoinEvent{{Email: "u1", Datetime: 110, Reason: ReasonJoined}},
+			expectedLeaves: []LeaveEvent{{Email: "u1", Datetime: 200, Reason: ReasonWindowEnd}},
+		},
+		{
+			name:      "joined within the window but the recorded leave falls after it",
+			startTime: 100,
+			endTime:   200,
+			history: []MembershipInterval{
+				{UserId: "u1", JoinTime: 110, LeaveTime: leaveTime(250)},
+			},
+			expectedJoins:  []JoinEvent{{Email: "u1", Datetime: 110, Reason: ReasonJoined}},
+			expectedLeaves: []LeaveEvent{{Email: "u1", Datetime: 200, Reason: ReasonWindowEnd}},
+		},
+		{
+			name:      "membership interval entirely before the window",
+			startTime: 100,
+			endTime:   200,
+			history: []MembershipInterval{
+				{UserId: "u1", JoinTime: 10, LeaveTime: leaveTime(50)},
+			},
+			expectedJoins:  nil,
+			expectedLeaves: nil,
+		},
+		{
+			name:      "membership interval entirely after the window",
+			startTime: 100,
+			endTime:   200,
+			history: []MembershipInterval{
+				{UserId: "u1", JoinTime: 250, LeaveTime: leaveTime(300)},
+			},
+			expectedJoins:  nil,
+			expectedLeaves: nil,
+		},
+		{
+			name:      "a recorded leave reason is preserved",
+			startTime: 100,
+			endTime:   200,
+			history: []MembershipInterval{
+				{UserId: "u1", JoinTime: 110, LeaveTime: leaveTime(150), LeaveReason: ReasonKicked},
+			},
+			expectedJoins:  []JoinEvent{{Email: "u1", Datetime: 110, Reason: ReasonJoined}},
+			expectedLeaves: []LeaveEvent{{Email: "u1", Datetime: 150, Reason: ReasonKicked}},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			joins, leaves := GetJoinsAndLeavesForChannel(tc.startTime, tc.endTime, tc.history, ChannelMembers{})
+			assert.Equal(t, tc.expectedJoins, joins)
+			assert.Equal(t, tc.expectedLeaves, leaves)
+		})
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.enterprise for license information.
+
+// Package eml_export implements a MessageExport backend that emits RFC 5322 / MIME ".eml"
+// files, one per conversation thread, for ingestion by journaling archives (e.g. Microsoft
+// Purview) that expect email-shaped input rather than the Actiance XML schema.
+package eml_export
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost/server/v8/enterprise/message_export/common_export"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/shared/mlog"
+	"github.com/mattermost/mattermost/server/public/shared/request"
+	"github.com/mattermost/mattermost/server/v8/channels/store"
+	"github.com/mattermost/mattermost/server/v8/platform/shared/filestore"
+)
+
+const (
+	EMLFileExtension   = ".eml"
+	EMLWarningFilename = "warning.txt"
+)
+
+// thread is every post (and its attachments) that belongs to the same conversation thread
+// within a single channel. A post with no RootId is the root of its own thread.
+type thread struct {
+	channel  common_export.MetadataChannel
+	threadId string
+	posts    []*model.MessageExport
+}
+
+// EMLExport writes one .eml file per conversation thread to exportBackend. Each file is a
+// multipart/mixed MIME message: a text/plain part per post in the thread, followed by a
+// base64-encoded part per file attachment.
+func EMLExport(rctx request.CTX, posts []*model.MessageExport, db store.Store, exportBackend filestore.FileBackend, fileAttachmentBackend filestore.FileBackend, exportDirectory string) (warningCount int64, appErr *model.AppError) {
+	metadata := common_export.Metadata{
+		Channels:         map[string]common_export.MetadataChannel{},
+		MessagesCount:    0,
+		AttachmentsCount: 0,
+		StartTime:        0,
+		EndTime:          0,
+	}
+	membersByChannel := common_export.MembersByChannel{}
+	threadsByKey := map[string]*thread{}
+	var threadOrder []string
+
+	for _, post := range posts {
+		if post == nil {
+			rctx.Logger().Warn("ignored a nil post reference in the list")
+			continue
+		}
+		metadata.Update(post, len(post.PostFileIds))
+
+		key := *post.ChannelId + "|" + threadIdForPost(post)
+		t, ok := threadsByKey[key]
+		if !ok {
+			t = &thread{threadId: threadIdForPost(post)}
+			threadsByKey[key] = t
+			threadOrder = append(threadOrder, key)
+		}
+		t.posts = append(t.posts, post)
+
+		if _, ok := membersByChannel[*post.ChannelId]; !ok {
+			membersByChannel[*post.ChannelId] = common_export.ChannelMembers{}
+		}
+		membersByChannel[*post.ChannelId][*post.UserId] = common_export.ChannelMember{
+			Email:    *post.UserEmail,
+			UserId:   *post.UserId,
+			IsBot:    post.IsBot,
+			Username: *post.Username,
+		}
+	}
+
+	channelRecipients, appErr := recipientsByChannel(metadata.Channels, membersByChannel, db)
+	if appErr != nil {
+		return warningCount, appErr
+	}
+
+	var missingFiles []string
+	for _, key := range threadOrder {
+		t := threadsByKey[key]
+		t.channel = metadata.Channels[*t.posts[0].ChannelId]
+
+		sort.Slice(t.posts, func(i, j int) bool {
+			return *t.posts[i].PostCreateAt < *t.posts[j].PostCreateAt
+		})
+
+		emlData, missing, err := threadToEML(rctx, t, db, fileAttachmentBackend, channelRecipients[t.channel.ChannelId])
+		if err != nil {
+			return warningCount, err
+		}
+		missingFiles = append(missingFiles, missing...)
+
+		filename := emlFilename(t)
+		if _, err := filestore.TryWriteFileContext(rctx.Context(), exportBackend, emlData, path.Join(exportDirectory, filename)); err != nil {
+			return warningCount, model.NewAppError("EMLExport.EMLExport", "ent.eml_export.write_file.appError", nil, "", 0).Wrap(err)
+		}
+	}
+
+	warningCount = int64(len(missingFiles))
+	if warningCount > 0 {
+		_, err := filestore.TryWriteFileContext(rctx.Context(), exportBackend, strings.NewReader(strings.Join(missingFiles, "\n")), path.Join(exportDirectory, EMLWarningFilename))
+		if err != nil {
+			appErr = model.NewAppError("EMLExport.EMLExport", "ent.eml_export.write_file.appError", nil, "", 0).Wrap(err)
+		}
+	}
+	return warningCount, appErr
+}
+
+// threadIdForPost returns the conversation thread a post belongs to: its RootId if it's a
+// reply, or its own PostId if it's a thread root.
+func threadIdForPost(post *model.MessageExport) string {
+	if post.PostRootId != nil && *post.PostRootId != "" {
+		return *post.PostRootId
+	}
+	return *post.PostId
+}
+
+// emlFilename names the export file after the channel and thread ("<channelId>_<threadId>.eml"),
+// so every thread of a channel shares the same prefix in exportDirectory. The name carries no
+// timestamp, so files do not sort by thread start time.
+func emlFilename(t *thread) string {
+	return fmt.Sprintf("%s_%s%s", t.channel.ChannelId, t.threadId, EMLFileExtension)
+}
+
+// threadToEML renders a thread as a multipart/mixed MIME message: one text/plain part per
+// post followed by one base64 part per file attachment, streamed in from fileAttachmentBackend.
+// recipients are the channel members active during the export window, used as the To: list.
+func threadToEML(rctx request.CTX, t *thread, db store.Store, fileAttachmentBackend filestore.FileBackend, recipients []string) (io.Reader, []string, *model.AppError) {
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+
+	root := t.posts[0]
+	fmt.Fprintf(buf, "From: %s\r\n", *root.UserEmail)
+	fmt.Fprintf(buf, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", fmt.Sprintf("%s - %s", t.channel.ChannelDisplayName, t.threadId)))
+	fmt.Fprintf(buf, "Date: %s\r\n", time.UnixMilli(*root.PostCreateAt).UTC().Format(time.RFC1123Z))
+	fmt.Fprintf(buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", writer.Boundary())
+
+	var missingFiles []string
+	for _, post := range t.posts {
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"8bit"},
+			"X-Mattermost-LoginName":    {*post.UserEmail},
+			"X-Mattermost-DateTimeUTC":  {fmt.Sprintf("%d", *post.PostCreateAt)},
+		})
+		if err != nil {
+			return nil, nil, model.NewAppError("EMLExport.threadToEML", "ent.eml_export.marshal.appError", nil, "", 0).Wrap(err)
+		}
+		if _, err := io.WriteString(part, *post.PostMessage); err != nil {
+			return nil, nil, model.NewAppError("EMLExport.threadToEML", "ent.eml_export.marshal.appError", nil, "", 0).Wrap(err)
+		}
+
+		if len(post.PostFileIds) == 0 {
+			continue
+		}
+		fileInfos, fErr := db.FileInfo().GetForPost(*post.PostId, true, true, false)
+		if fErr != nil {
+			return nil, nil, model.NewAppError("EMLExport.threadToEML", "ent.eml_export.get_attachment_error", nil, "", http.StatusInternalServerError).Wrap(fErr)
+		}
+		for _, fileInfo := range fileInfos {
+			missing, err := writeAttachmentPart(writer, fileAttachmentBackend, fileInfo)
+			if err != nil {
+				return nil, nil, err
+			}
+			if missing != "" {
+				missingFiles = append(missingFiles, missing)
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, nil, model.NewAppError("EMLExport.threadToEML", "ent.eml_export.marshal.appError", nil, "", 0).Wrap(err)
+	}
+	return buf, missingFiles, nil
+}
+
+// writeAttachmentPart streams a single file attachment into the MIME writer as a
+// base64-encoded part, matching the way mail clients embed binary attachments.
+func writeAttachmentPart(writer *multipart.Writer, fileAttachmentBackend filestore.FileBackend, fileInfo *model.FileInfo) (missing string, appErr *model.AppError) {
+	attachmentSrc, nErr := fileAttachmentBackend.Reader(fileInfo.Path)
+	if nErr != nil {
+		return "Warning:" + common_export.MissingFileMessage + " - " + fileInfo.Path, nil
+	}
+	defer attachmentSrc.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(fileInfo.Name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", fileInfo.Name)},
+	})
+	if err != nil {
+		return "", model.NewAppError("EMLExport.writeAttachmentPart", "ent.eml_export.marshal.appError", nil, "", 0).Wrap(err)
+	}
+
+	encoder := base64.NewEncoder(base64.StdEncoding, part)
+	defer encoder.Close()
+	if _, err := io.Copy(encoder, attachmentSrc); err != nil {
+		return "", model.NewAppError("EMLExport.writeAttachmentPart", "ent.eml_export.write_file.appError", nil, "", 0).Wrap(err)
+	}
+	return "", nil
+}
+
+// recipientsByChannel looks up, for every channel a post came from, the channel members active
+// during that channel's export window -- the same join/leave pairing the actiance path uses --
+// and returns their emails as the To: addresses for every thread in that channel. This mirrors
+// who would actually have seen the thread in Mattermost, rather than just who happened to post
+// in a given thread.
+func recipientsByChannel(channels map[string]common_export.MetadataChannel, membersByChannel common_export.MembersByChannel, db store.Store) (map[string][]string, *model.AppError) {
+	recipients := map[string][]string{}
+	for channelId, channel := range channels {
+		channelMembersHistory, err := db.ChannelMemberHistory().GetUsersInChannelDuring(channel.StartTime, channel.EndTime, channelId)
+		if err != nil {
+			return nil, model.NewAppError("EMLExport.recipientsByChannel", "ent.eml_export.get_users_in_channel_during", nil, "", http.StatusInternalServerError).Wrap(err)
+		}
+
+		joins, _ := common_export.GetJoinsAndLeavesForChannel(channel.StartTime, channel.EndTime, common_export.MembershipIntervalsFromHistory(channelMembersHistory), membersByChannel[channelId])
+
+		seen := map[string]bool{}
+		var emails []string
+		for _, join := range joins {
+			if join.Email == "" || seen[join.Email] {
+				continue
+			}
+			seen[join.Email] = true
+			emails = append(emails, join.Email)
+		}
+		recipients[channelId] = emails
+	}
+	return recipients, nil
+}
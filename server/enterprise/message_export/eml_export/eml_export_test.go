@@ -0,0 +1,71 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.enterprise for license information.
+
+package eml_export
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/mail"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/v8/enterprise/message_export/common_export"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestThreadToEML(t *testing.T) {
+	root := &model.MessageExport{
+		ChannelId:          ptr("channel1"),
+		ChannelName:        ptr("town-square"),
+		ChannelDisplayName: ptr("Town Square"),
+		ChannelType:        ptr(model.ChannelTypeOpen),
+		UserEmail:          ptr("alice@example.com"),
+		Username:           ptr("alice"),
+		PostId:             ptr("post1"),
+		PostCreateAt:       ptr(int64(1000)),
+		PostMessage:        ptr("hello there"),
+	}
+	reply := &model.MessageExport{
+		ChannelId:    ptr("channel1"),
+		UserEmail:    ptr("bob@example.com"),
+		Username:     ptr("bob"),
+		PostId:       ptr("post2"),
+		PostRootId:   ptr("post1"),
+		PostCreateAt: ptr(int64(2000)),
+		PostMessage:  ptr("hi alice"),
+	}
+	th := &thread{
+		channel: common_export.MetadataChannel{
+			ChannelId:          "channel1",
+			ChannelDisplayName: "Town Square",
+		},
+		threadId: "post1",
+		posts:    []*model.MessageExport{root, reply},
+	}
+	recipients := []string{"alice@example.com", "bob@example.com"}
+
+	emlData, missing, appErr := threadToEML(nil, th, nil, nil, recipients)
+	require.Nil(t, appErr)
+	require.Empty(t, missing)
+
+	raw, err := io.ReadAll(emlData)
+	require.NoError(t, err)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err)
+	require.Equal(t, "1.0", msg.Header.Get("Mime-Version"))
+	require.Equal(t, "alice@example.com", msg.Header.Get("From"))
+	require.Equal(t, "alice@example.com, bob@example.com", msg.Header.Get("To"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/mixed", mediaType)
+	require.NotEmpty(t, params["boundary"])
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.enterprise for license information.
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+
+	"github.com/mattermost/mattermost/server/v8/platform/shared/filestore"
+)
+
+// HTTPSConfig points at the endpoint an archival vendor exposes for receiving exports as
+// multipart PUT uploads, e.g. https://archive.example.com/ingest/<export-id>.
+type HTTPSConfig struct {
+	URL         string
+	BearerToken string
+	// Client defaults to http.DefaultClient if left nil.
+	Client *http.Client
+}
+
+// HTTPSTransport delivers an export as one multipart/form-data PUT request per file. Unlike
+// SFTPTransport and S3Transport it has no way to check what the destination already has, so a
+// retried Deliver call re-sends every file; vendors behind this transport are expected to treat
+// a repeated PUT of the same file as an overwrite, not a duplicate.
+type HTTPSTransport struct {
+	config HTTPSConfig
+}
+
+func NewHTTPSTransport(config HTTPSConfig) *HTTPSTransport {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &HTTPSTransport{config: config}
+}
+
+func (t *HTTPSTransport) Name() string {
+	return "https"
+}
+
+func (t *HTTPSTransport) Deliver(ctx context.Context, exportBackend filestore.FileBackend, exportDirectory string, files []string) error {
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := t.putOne(ctx, exportBackend, exportDirectory, file); err != nil {
+			return fmt.Errorf("transport.HTTPSTransport: %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func (t *HTTPSTransport) putOne(ctx context.Context, exportBackend filestore.FileBackend, exportDirectory, file string) error {
+	src, err := exportBackend.Reader(path.Join(exportDirectory, file))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", file)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, src); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.config.URL+"/"+file, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if t.config.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+t.config.BearerToken)
+	}
+
+	resp, err := t.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.enterprise for license information.
+
+package transport
+
+import (
+	"fmt"
+	stdplugin "plugin"
+)
+
+// LoadPluginTransport loads a Transport implementation from a Go plugin (a .so built with
+// `go build -buildmode=plugin`) at pluginPath, for vendors whose delivery protocol doesn't fit
+// SFTPTransport, S3Transport, or HTTPSTransport. The plugin must export a package-level function
+//
+//	func NewTransport(config map[string]string) (transport.Transport, error)
+//
+// named NewTransport.
+func LoadPluginTransport(pluginPath string, config map[string]string) (Transport, error) {
+	p, err := stdplugin.Open(pluginPath)
+	if err != nil {
+		return nil, fmt.Errorf("transport.LoadPluginTransport: open %s: %w", pluginPath, err)
+	}
+
+	sym, err := p.Lookup("NewTransport")
+	if err != nil {
+		return nil, fmt.Errorf("transport.LoadPluginTransport: %s must export NewTransport: %w", pluginPath, err)
+	}
+
+	constructor, ok := sym.(func(map[string]string) (Transport, error))
+	if !ok {
+		return nil, fmt.Errorf("transport.LoadPluginTransport: %s's NewTransport has the wrong signature", pluginPath)
+	}
+
+	return constructor(config)
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.enterprise for license information.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/mattermost/mattermost/server/v8/platform/shared/filestore"
+)
+
+// S3Config describes the customer-owned S3 (or S3-compatible) bucket an export should be copied
+// into. It mirrors filestore's own S3 settings rather than introducing a second schema, since
+// this is the same kind of connection exportBackend itself may already be using.
+type S3Config struct {
+	Endpoint        string
+	AccessKeyId     string
+	SecretAccessKey string
+	Bucket          string
+	PathPrefix      string
+	UseSSL          bool
+	Region          string
+}
+
+// S3Transport delivers an export by copying it into another filestore.FileBackend, reusing
+// filestore's own S3 driver so it gets the same retry and multipart-upload behavior as the rest
+// of the server.
+type S3Transport struct {
+	backend filestore.FileBackend
+}
+
+func NewS3Transport(config S3Config) (*S3Transport, error) {
+	backend, err := filestore.NewFileBackend(filestore.FileBackendSettings{
+		DriverName:              filestore.DriverS3,
+		AmazonS3AccessKeyId:     config.AccessKeyId,
+		AmazonS3SecretAccessKey: config.SecretAccessKey,
+		AmazonS3Bucket:          config.Bucket,
+		AmazonS3PathPrefix:      config.PathPrefix,
+		AmazonS3Endpoint:        config.Endpoint,
+		AmazonS3SSL:             config.UseSSL,
+		AmazonS3Region:          config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("transport.NewS3Transport: %w", err)
+	}
+	return &S3Transport{backend: backend}, nil
+}
+
+func (t *S3Transport) Name() string {
+	return "s3"
+}
+
+func (t *S3Transport) Deliver(ctx context.Context, exportBackend filestore.FileBackend, exportDirectory string, files []string) error {
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		destPath := path.Join(exportDirectory, file)
+		if done, err := t.alreadyDelivered(exportBackend, destPath); err == nil && done {
+			// a prior attempt already delivered this file under the same relative layout.
+			continue
+		}
+
+		reader, err := exportBackend.Reader(destPath)
+		if err != nil {
+			return fmt.Errorf("transport.S3Transport: %s: %w", file, err)
+		}
+		_, writeErr := t.backend.WriteFile(reader, destPath)
+		reader.Close()
+		if writeErr != nil {
+			return fmt.Errorf("transport.S3Transport: %s: %w", file, writeErr)
+		}
+	}
+	return nil
+}
+
+// alreadyDelivered compares destination and source file size, the same check
+// SFTPTransport.alreadyDelivered makes, so a retried Deliver call can skip a file a prior
+// attempt already wrote in full. A bare FileExists isn't enough: if a prior attempt died
+// mid-upload, the object still exists in the bucket but truncated, and skipping it on that
+// basis alone would leave a corrupt file at the delivery destination with no way to retry it.
+func (t *S3Transport) alreadyDelivered(exportBackend filestore.FileBackend, destPath string) (bool, error) {
+	exists, err := t.backend.FileExists(destPath)
+	if err != nil || !exists {
+		return false, err
+	}
+	destSize, err := t.backend.FileSize(destPath)
+	if err != nil {
+		return false, nil
+	}
+	srcSize, err := exportBackend.FileSize(destPath)
+	if err != nil {
+		return false, nil
+	}
+	return destSize == srcSize, nil
+}
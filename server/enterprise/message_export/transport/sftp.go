@@ -0,0 +1,134 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.enterprise for license information.
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/mattermost/mattermost/server/v8/platform/shared/filestore"
+)
+
+// SFTPConfig is the subset of connection details needed to ship an export to a customer's SFTP
+// archive. Exactly one of Password or PrivateKeyPEM should be set.
+type SFTPConfig struct {
+	Host            string
+	Port            int
+	Username        string
+	Password        string
+	PrivateKeyPEM   []byte
+	RemoteDirectory string
+	// HostKeyCallback is passed straight to ssh.Dial, which refuses to connect when it's nil,
+	// so it must always be set.
+	HostKeyCallback ssh.HostKeyCallback
+}
+
+// SFTPTransport delivers an export over SFTP using pkg/sftp.
+type SFTPTransport struct {
+	config SFTPConfig
+}
+
+func NewSFTPTransport(config SFTPConfig) *SFTPTransport {
+	return &SFTPTransport{config: config}
+}
+
+func (t *SFTPTransport) Name() string {
+	return "sftp"
+}
+
+func (t *SFTPTransport) Deliver(ctx context.Context, exportBackend filestore.FileBackend, exportDirectory string, files []string) error {
+	client, err := t.dial()
+	if err != nil {
+		return fmt.Errorf("transport.SFTPTransport: dial: %w", err)
+	}
+	defer client.Close()
+
+	if err := client.MkdirAll(t.config.RemoteDirectory); err != nil {
+		return fmt.Errorf("transport.SFTPTransport: mkdir %s: %w", t.config.RemoteDirectory, err)
+	}
+
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		remotePath := path.Join(t.config.RemoteDirectory, file)
+		done, err := t.alreadyDelivered(client, exportBackend, exportDirectory, file, remotePath)
+		if err != nil {
+			return fmt.Errorf("transport.SFTPTransport: %s: %w", file, err)
+		}
+		if done {
+			continue
+		}
+
+		if err := t.deliverOne(client, exportBackend, exportDirectory, file, remotePath); err != nil {
+			return fmt.Errorf("transport.SFTPTransport: %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func (t *SFTPTransport) dial() (*sftp.Client, error) {
+	var auth []ssh.AuthMethod
+	if len(t.config.PrivateKeyPEM) > 0 {
+		signer, err := ssh.ParsePrivateKey(t.config.PrivateKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if t.config.Password != "" {
+		auth = append(auth, ssh.Password(t.config.Password))
+	}
+
+	sshClient, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", t.config.Host, t.config.Port), &ssh.ClientConfig{
+		User:            t.config.Username,
+		Auth:            auth,
+		HostKeyCallback: t.config.HostKeyCallback,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sftp.NewClient(sshClient)
+}
+
+// alreadyDelivered compares remote and local file size so a retried Deliver call can skip a file
+// a prior attempt already copied in full, instead of re-uploading every file from scratch.
+func (t *SFTPTransport) alreadyDelivered(client *sftp.Client, exportBackend filestore.FileBackend, exportDirectory, file, remotePath string) (bool, error) {
+	remoteInfo, err := client.Stat(remotePath)
+	if err != nil {
+		return false, nil
+	}
+	localSize, sizeErr := exportBackend.FileSize(path.Join(exportDirectory, file))
+	if sizeErr != nil {
+		return false, nil
+	}
+	return remoteInfo.Size() == localSize, nil
+}
+
+func (t *SFTPTransport) deliverOne(client *sftp.Client, exportBackend filestore.FileBackend, exportDirectory, file, remotePath string) error {
+	src, err := exportBackend.Reader(path.Join(exportDirectory, file))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return err
+	}
+
+	dst, err := client.Create(remotePath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
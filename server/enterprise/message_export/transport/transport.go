@@ -0,0 +1,79 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.enterprise for license information.
+
+// Package transport ships a finished export batch (the XML or EML files it produced, their
+// attachments, and manifest.json) off to a customer-owned archival vendor once writeExport has
+// flushed it to exportDirectory, so customers don't need to run an external scheduler just to
+// pick exports up from the configured filestore.
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/v8/platform/shared/filestore"
+)
+
+// Transport delivers a set of already-written export files to an external destination.
+// Implementations should be idempotent: Deliver may be called more than once for the same
+// exportDirectory after a prior attempt failed partway through, and should skip whatever it can
+// tell the destination already has rather than re-sending everything.
+type Transport interface {
+	// Name identifies the transport in logs and in the Receipt written back to exportDirectory.
+	Name() string
+	// Deliver reads each of files (paths relative to exportDirectory) from exportBackend and
+	// sends it to the destination.
+	Deliver(ctx context.Context, exportBackend filestore.FileBackend, exportDirectory string, files []string) error
+}
+
+// ReceiptFilename is written into exportDirectory once Deliver succeeds, alongside
+// manifest.json, so a customer's own tooling (or a future export into the same directory) can
+// tell whether, when, and where a batch was already shipped.
+const ReceiptFilename = "delivery_receipt.json"
+
+// Receipt records the outcome of a successful delivery.
+type Receipt struct {
+	Transport   string   `json:"transport"`
+	DeliveredAt int64    `json:"delivered_at"`
+	Files       []string `json:"files"`
+}
+
+// NewReceipt builds the Receipt for a delivery of files via t, completed at deliveredAt (a Unix
+// millisecond timestamp supplied by the caller, since this package doesn't read the clock).
+func NewReceipt(t Transport, deliveredAt int64, files []string) Receipt {
+	return Receipt{Transport: t.Name(), DeliveredAt: deliveredAt, Files: files}
+}
+
+// Marshal renders a Receipt the same way writeManifest renders manifest.json.
+func (r Receipt) Marshal() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// DeliverWithRetry calls t.Deliver, retrying with exponential backoff (starting at one second,
+// capped at maxBackoff) until it succeeds or maxAttempts is reached. Each Transport
+// implementation is expected to resume rather than restart on a retry, since it's given the same
+// file list every time and is responsible for recognizing what a prior, failed attempt already
+// delivered.
+func DeliverWithRetry(ctx context.Context, t Transport, exportBackend filestore.FileBackend, exportDirectory string, files []string, maxAttempts int, maxBackoff time.Duration) error {
+	backoff := time.Second
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+
+		if lastErr = t.Deliver(ctx, exportBackend, exportDirectory, files); lastErr == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("transport: %s delivery failed after %d attempt(s): %w", t.Name(), maxAttempts, lastErr)
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.enterprise for license information.
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost/server/v8/platform/shared/filestore"
+)
+
+// fakeTransport fails its first `failures` calls to Deliver, then succeeds.
+type fakeTransport struct {
+	failures int
+	calls    int
+}
+
+func (t *fakeTransport) Name() string { return "fake" }
+
+func (t *fakeTransport) Deliver(ctx context.Context, exportBackend filestore.FileBackend, exportDirectory string, files []string) error {
+	t.calls++
+	if t.calls <= t.failures {
+		return errors.New("destination unreachable")
+	}
+	return nil
+}
+
+func TestDeliverWithRetrySucceedsAfterTransientFailures(t *testing.T) {
+	transport := &fakeTransport{failures: 1}
+
+	err := DeliverWithRetry(context.Background(), transport, nil, "export-dir", nil, 3, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, 2, transport.calls)
+}
+
+func TestDeliverWithRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	transport := &fakeTransport{failures: 2}
+
+	err := DeliverWithRetry(context.Background(), transport, nil, "export-dir", nil, 2, time.Second)
+	require.Error(t, err)
+	require.Equal(t, 2, transport.calls)
+}
+
+func TestDeliverWithRetryStopsOnContextCancellation(t *testing.T) {
+	transport := &fakeTransport{failures: 10}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := DeliverWithRetry(ctx, transport, nil, "export-dir", nil, 5, time.Second)
+	require.ErrorIs(t, err, context.Canceled)
+	// the first attempt still runs before the retry loop checks ctx; only the wait before the
+	// second attempt is where cancellation is observed.
+	require.Equal(t, 1, transport.calls)
+}